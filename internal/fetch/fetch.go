@@ -0,0 +1,94 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fetch resolves hierarchy.lst entries that name a remote source instead of a local
+// path, downloading them into a cache directory so the rest of hierarchy can keep treating
+// every layer as a plain directory on disk.
+package fetch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+)
+
+// Fetcher downloads the source identified by uri into a subdirectory of cacheDir and returns
+// the local directory that now contains it. When offline is true, implementations must not
+// perform network access and should fail if the source isn't already present in cacheDir.
+type Fetcher interface {
+	Fetch(ctx context.Context, uri string, cacheDir string, offline bool) (localDir string, err error)
+}
+
+// registry maps a URI scheme (as returned by Scheme) to the Fetcher that handles it.
+var registry = map[string]Fetcher{}
+
+// Register associates a Fetcher with a URI scheme, such as "http" or "git+https". It is
+// typically called from an init function of a Fetcher implementation.
+func Register(scheme string, fetcher Fetcher) {
+	registry[scheme] = fetcher
+}
+
+// Lookup returns the Fetcher registered for scheme, if any.
+func Lookup(scheme string) (Fetcher, bool) {
+	fetcher, ok := registry[scheme]
+	return fetcher, ok
+}
+
+// Scheme returns the URI scheme of entry (e.g. "https", "git+https", "s3") and true, or ""
+// and false if entry is a plain local path with no scheme. A "file" URI is recognized even
+// without a host, since its standard three-slash form (file:///abs/path) parses with an empty
+// Host and the path in u.Path; an opaque "file:"-prefixed entry with no slashes (u.Opaque set
+// instead of u.Path), or a degenerate "file:"/"file://" entry with no path at all, is not a URI
+// this package knows how to fetch and is left as a local path.
+func Scheme(entry string) (string, bool) {
+	u, err := url.Parse(entry)
+	if err != nil || u.Scheme == "" {
+		return "", false
+	}
+	if u.Scheme == "file" {
+		if u.Opaque != "" || u.Path == "" {
+			return "", false
+		}
+		return u.Scheme, true
+	}
+	if u.Host == "" {
+		return "", false
+	}
+	return u.Scheme, true
+}
+
+// Fetch resolves uri by dispatching to the Fetcher registered for its scheme.
+func Fetch(ctx context.Context, uri string, cacheDir string, offline bool) (string, error) {
+	scheme, ok := Scheme(uri)
+	if !ok {
+		return "", fmt.Errorf("fetch: %q has no URI scheme", uri)
+	}
+
+	fetcher, ok := Lookup(scheme)
+	if !ok {
+		return "", fmt.Errorf("fetch: no fetcher registered for scheme %q", scheme)
+	}
+
+	return fetcher.Fetch(ctx, uri, cacheDir, offline)
+}
+
+// cacheKey returns a filesystem-safe, stable directory name for uri.
+func cacheKey(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheme(t *testing.T) {
+	scheme, ok := Scheme("../default")
+	assert.False(t, ok)
+	assert.Empty(t, scheme)
+
+	scheme, ok = Scheme("https://example.com/defaults.yml")
+	assert.True(t, ok)
+	assert.Equal(t, "https", scheme)
+
+	scheme, ok = Scheme("git+https://example.com/configs.git#ref=main&path=prod")
+	assert.True(t, ok)
+	assert.Equal(t, "git+https", scheme)
+
+	scheme, ok = Scheme("file:///tmp/filetest/cfgdir")
+	assert.True(t, ok)
+	assert.Equal(t, "file", scheme)
+
+	// an opaque "file:"-prefixed entry with no slashes is not a URI this package can fetch
+	// and must be left for the plain-local-path branch, not dispatched to FileFetcher.
+	scheme, ok = Scheme("file:relative/configs")
+	assert.False(t, ok)
+	assert.Empty(t, scheme)
+
+	// a degenerate "file://" entry with no path at all must not be dispatched either, since
+	// FileFetcher would resolve it to an empty directory with no error.
+	scheme, ok = Scheme("file://")
+	assert.False(t, ok)
+	assert.Empty(t, scheme)
+}
+
+func TestParseGitURI(t *testing.T) {
+	repoURL, ref, path, err := parseGitURI("git+https://example.com/configs.git#ref=main&path=prod")
+	assert.NoError(t, err)
+	assert.Equal(t, "https://example.com/configs.git", repoURL)
+	assert.Equal(t, "main", ref)
+	assert.Equal(t, "prod", path)
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	const body = "app:\n  env: remote\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cacheDir, err := ioutil.TempDir("", "hierarchy-fetch-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	dir, err := HTTPFetcher{}.Fetch(context.Background(), srv.URL+"/defaults.yml", cacheDir, false)
+	assert.NoError(t, err)
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "defaults.yml"))
+	assert.NoError(t, err)
+	assert.Equal(t, body, string(data))
+}
+
+func TestFileFetcher(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "hierarchy-fetch-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	dir, err := FileFetcher{}.Fetch(context.Background(), "file:///tmp/filetest/cfgdir", cacheDir, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "/tmp/filetest/cfgdir", dir)
+}
+
+func TestHTTPFetcherOfflineRequiresCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "hierarchy-fetch-test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(cacheDir)
+
+	_, err = HTTPFetcher{}.Fetch(context.Background(), "https://example.com/defaults.yml", cacheDir, true)
+	assert.Error(t, err)
+}
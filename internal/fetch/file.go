@@ -0,0 +1,40 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"context"
+	"net/url"
+)
+
+func init() {
+	Register("file", FileFetcher{})
+}
+
+// FileFetcher resolves a `file://` URI straight to its local path, with no caching or network
+// access involved.
+type FileFetcher struct{}
+
+// Fetch implements Fetcher.
+func (FileFetcher) Fetch(_ context.Context, uri string, _ string, _ bool) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+
+	return u.Path, nil
+}
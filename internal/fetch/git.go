@@ -0,0 +1,95 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+func init() {
+	Register("git", GitFetcher{})
+	Register("git+https", GitFetcher{})
+	Register("git+ssh", GitFetcher{})
+}
+
+// GitFetcher clones a git repository into the cache directory and returns the subdirectory
+// named by the `path=` fragment parameter, defaulting to the repository root. The `ref=`
+// fragment parameter selects the branch, tag or commit to check out, defaulting to the
+// repository's default branch. For example:
+//
+//	git+https://example.com/configs.git#ref=main&path=prod
+type GitFetcher struct{}
+
+// Fetch implements Fetcher.
+func (GitFetcher) Fetch(ctx context.Context, uri string, cacheDir string, offline bool) (string, error) {
+	repoURL, ref, path, err := parseGitURI(uri)
+	if err != nil {
+		return "", err
+	}
+
+	destDir := filepath.Join(cacheDir, cacheKey(uri))
+
+	if offline {
+		if _, err := os.Stat(destDir); err != nil {
+			return "", fmt.Errorf("fetch: %s is not cached and --offline is set: %w", uri, err)
+		}
+		return filepath.Join(destDir, path), nil
+	}
+
+	if err := os.RemoveAll(destDir); err != nil {
+		return "", err
+	}
+
+	args := []string{"clone", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, repoURL, destDir)
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("fetch: git clone of %s failed: %w: %s", repoURL, err, out)
+	}
+
+	return filepath.Join(destDir, path), nil
+}
+
+// parseGitURI splits a `git+<scheme>://host/repo#ref=...&path=...` URI into the underlying
+// repository URL and its ref/path fragment parameters.
+func parseGitURI(uri string) (repoURL string, ref string, path string, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", "", "", err
+	}
+
+	query, err := url.ParseQuery(u.Fragment)
+	if err != nil {
+		return "", "", "", fmt.Errorf("fetch: invalid fragment in %q: %w", uri, err)
+	}
+
+	scheme := strings.TrimPrefix(u.Scheme, "git+")
+	u.Scheme = scheme
+	u.Fragment = ""
+
+	return u.String(), query.Get("ref"), query.Get("path"), nil
+}
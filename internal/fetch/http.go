@@ -0,0 +1,96 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+func init() {
+	Register("http", HTTPFetcher{})
+	Register("https", HTTPFetcher{})
+}
+
+// HTTPFetcher downloads a single file over http(s) into its own cache directory, so the
+// existing directory-based merge logic can pick it up like any other layer.
+type HTTPFetcher struct{}
+
+// Fetch implements Fetcher.
+func (HTTPFetcher) Fetch(ctx context.Context, uri string, cacheDir string, offline bool) (string, error) {
+	destDir := filepath.Join(cacheDir, cacheKey(uri))
+	destFile := filepath.Join(destDir, fileName(uri))
+
+	if offline {
+		if _, err := os.Stat(destFile); err != nil {
+			return "", fmt.Errorf("fetch: %s is not cached and --offline is set: %w", uri, err)
+		}
+		return destDir, nil
+	}
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetch: %s returned status %s", uri, resp.Status)
+	}
+
+	out, err := os.Create(destFile)
+	if err != nil {
+		return "", err
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return "", err
+	}
+
+	return destDir, nil
+}
+
+// fileName derives the cached file name from the last path segment of uri, falling back to
+// "download" for URLs with no path (e.g. "https://example.com").
+func fileName(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "download"
+	}
+
+	name := filepath.Base(u.Path)
+	if name == "" || name == "." || name == "/" {
+		return "download"
+	}
+
+	return name
+}
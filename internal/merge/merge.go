@@ -0,0 +1,264 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package merge implements the document merge engine behind hierarchy's config
+// layering: combining the generic map[string]interface{} documents decoded from
+// each layer's YAML/JSON files into a single accumulated result.
+package merge
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Strategy selects how a layer's documents are combined with the accumulated result.
+type Strategy string
+
+const (
+	// DeepMerge recursively merges maps and replaces any other value, including lists.
+	// This is the default strategy and preserves hierarchy's original override behavior.
+	DeepMerge Strategy = "deepMerge"
+
+	// Replace discards the accumulated result entirely and starts over with the layer's content.
+	Replace Strategy = "replace"
+
+	// Strategic recognizes `$patch` directives inside the layer's documents: `delete` removes
+	// a key (or, inside a list, a matching item), `replace` wipes a subtree instead of merging
+	// it, and `merge` on a list concatenates instead of replacing.
+	Strategic Strategy = "strategic"
+)
+
+// patchKey is the reserved map key that carries a strategic-merge directive.
+const patchKey = "$patch"
+
+// ParseStrategy resolves the strategy named by a hierarchy.lst `[strategy=...]` directive.
+// An empty name resolves to DeepMerge, which keeps existing hierarchy.lst files working
+// unchanged.
+func ParseStrategy(name string) (Strategy, error) {
+	switch Strategy(name) {
+	case "", DeepMerge:
+		return DeepMerge, nil
+	case Replace:
+		return Replace, nil
+	case Strategic:
+		return Strategic, nil
+	default:
+		return "", fmt.Errorf("unknown merge strategy %q", name)
+	}
+}
+
+// Merge combines src into dst according to strategy and returns the resulting document.
+// dst may be nil, in which case a fresh map is built from src.
+func Merge(dst, src map[string]interface{}, strategy Strategy) map[string]interface{} {
+	switch strategy {
+	case Replace:
+		return cloneMap(src)
+	case Strategic:
+		return mergeStrategic(dst, src)
+	default:
+		return mergeDeep(dst, src)
+	}
+}
+
+// mergeDeep recursively merges maps; any non-map value in src overrides the value in dst,
+// including lists, which are always replaced wholesale.
+func mergeDeep(dst, src map[string]interface{}) map[string]interface{} {
+	result := copyShallow(dst)
+
+	for key, srcValue := range src {
+		srcMap, srcIsMap := asMap(srcValue)
+		dstMap, dstIsMap := asMap(result[key])
+		if srcIsMap && dstIsMap {
+			result[key] = mergeDeep(dstMap, srcMap)
+			continue
+		}
+		result[key] = srcValue
+	}
+
+	return result
+}
+
+// mergeStrategic recursively merges maps like mergeDeep, but honors `$patch` directives:
+// a `$patch: replace` on src wipes dst's subtree before applying, a `$patch: delete` under a
+// key removes that key instead of merging it, and lists are merged through mergeStrategicList.
+func mergeStrategic(dst, src map[string]interface{}) map[string]interface{} {
+	if isPatchReplace(src) {
+		return cloneMap(withoutPatchKey(src))
+	}
+
+	result := copyShallow(dst)
+
+	for key, srcValue := range src {
+		if key == patchKey {
+			continue
+		}
+
+		if isPatchDelete(srcValue) {
+			delete(result, key)
+			continue
+		}
+
+		switch sv := srcValue.(type) {
+		case map[string]interface{}:
+			if isPatchReplace(sv) {
+				result[key] = cloneMap(withoutPatchKey(sv))
+				continue
+			}
+			dstMap, _ := result[key].(map[string]interface{})
+			result[key] = mergeStrategic(dstMap, sv)
+		case []interface{}:
+			dstList, _ := result[key].([]interface{})
+			result[key] = mergeStrategicList(dstList, sv)
+		default:
+			result[key] = srcValue
+		}
+	}
+
+	return result
+}
+
+// mergeStrategicList applies strategic-merge semantics to a list: a leading `{$patch: merge}`
+// marker switches from the default replace behavior to concatenation, and any item carrying
+// `$patch: delete` removes the dst item(s) whose fields match the marker's other fields.
+func mergeStrategicList(dst, src []interface{}) []interface{} {
+	concatenate := false
+	items := make([]interface{}, 0, len(src))
+
+	for _, item := range src {
+		if m, ok := item.(map[string]interface{}); ok && isMergeMarker(m) {
+			concatenate = true
+			continue
+		}
+		items = append(items, item)
+	}
+
+	if !concatenate {
+		return items
+	}
+
+	result := append([]interface{}{}, dst...)
+	for _, item := range items {
+		if fields, ok := deleteMarkerFields(item); ok {
+			result = removeMatching(result, fields)
+			continue
+		}
+		result = append(result, item)
+	}
+
+	return result
+}
+
+// isPatchReplace reports whether m carries a top-level `$patch: replace` directive.
+func isPatchReplace(m map[string]interface{}) bool {
+	v, ok := m[patchKey]
+	return ok && v == "replace"
+}
+
+// isPatchDelete reports whether v is a map carrying a `$patch: delete` directive.
+func isPatchDelete(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	return ok && m[patchKey] == "delete"
+}
+
+// isMergeMarker reports whether m is the `{$patch: merge}` sequence-level marker.
+func isMergeMarker(m map[string]interface{}) bool {
+	return len(m) == 1 && m[patchKey] == "merge"
+}
+
+// deleteMarkerFields returns the merge-key fields of a list item carrying `$patch: delete`,
+// i.e. every field other than $patch itself, which is used to find the matching dst item.
+func deleteMarkerFields(item interface{}) (map[string]interface{}, bool) {
+	m, ok := item.(map[string]interface{})
+	if !ok || m[patchKey] != "delete" {
+		return nil, false
+	}
+	return withoutPatchKey(m), true
+}
+
+// removeMatching drops every map item from list whose fields match all of fields.
+func removeMatching(list []interface{}, fields map[string]interface{}) []interface{} {
+	var result []interface{}
+	for _, item := range list {
+		if m, ok := item.(map[string]interface{}); ok && matchesAll(m, fields) {
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+// matchesAll reports whether m contains every key/value pair in fields.
+func matchesAll(m, fields map[string]interface{}) bool {
+	for k, v := range fields {
+		if mv, ok := m[k]; !ok || !reflect.DeepEqual(mv, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// withoutPatchKey returns a shallow copy of m with the $patch directive removed.
+func withoutPatchKey(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k == patchKey {
+			continue
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// copyShallow returns a one-level copy of m, or a fresh empty map if m is nil. mergeDeep uses
+// this instead of mutating dst in place so that callers retaining a reference to the
+// pre-merge document (such as provenance tracking) see it unchanged.
+func copyShallow(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// asMap normalizes v into a map[string]interface{}, reporting whether it is one.
+func asMap(v interface{}) (map[string]interface{}, bool) {
+	m, ok := v.(map[string]interface{})
+	return m, ok
+}
+
+// cloneMap deep-copies a document tree made of the types produced by YAML/JSON decoding.
+func cloneMap(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return cloneMap(val)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = cloneValue(item)
+		}
+		return out
+	default:
+		return val
+	}
+}
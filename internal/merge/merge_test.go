@@ -0,0 +1,165 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package merge
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStrategy(t *testing.T) {
+	s, err := ParseStrategy("")
+	assert.NoError(t, err)
+	assert.Equal(t, DeepMerge, s)
+
+	s, err = ParseStrategy("strategic")
+	assert.NoError(t, err)
+	assert.Equal(t, Strategic, s)
+
+	_, err = ParseStrategy("bogus")
+	assert.Error(t, err)
+}
+
+func TestMergeDeepNestedMaps(t *testing.T) {
+	dst := map[string]interface{}{
+		"app": map[string]interface{}{
+			"name": "hierarchy",
+			"env":  "default",
+		},
+	}
+	src := map[string]interface{}{
+		"app": map[string]interface{}{
+			"env": "prod",
+		},
+	}
+
+	result := Merge(dst, src, DeepMerge)
+
+	expected := map[string]interface{}{
+		"app": map[string]interface{}{
+			"name": "hierarchy",
+			"env":  "prod",
+		},
+	}
+	assert.Equal(t, expected, result)
+}
+
+func TestMergeDeepListsAreReplaced(t *testing.T) {
+	dst := map[string]interface{}{"items": []interface{}{"a", "b"}}
+	src := map[string]interface{}{"items": []interface{}{"c"}}
+
+	result := Merge(dst, src, DeepMerge)
+
+	assert.Equal(t, []interface{}{"c"}, result["items"])
+}
+
+func TestMergeReplaceWipesPriorLayer(t *testing.T) {
+	dst := map[string]interface{}{"app": map[string]interface{}{"name": "hierarchy"}}
+	src := map[string]interface{}{"database": map[string]interface{}{"host": "localhost"}}
+
+	result := Merge(dst, src, Replace)
+
+	assert.Equal(t, map[string]interface{}{"database": map[string]interface{}{"host": "localhost"}}, result)
+}
+
+func TestMergeStrategicPatchDelete(t *testing.T) {
+	dst := map[string]interface{}{
+		"app": map[string]interface{}{"name": "hierarchy", "env": "default"},
+	}
+	src := map[string]interface{}{
+		"app": map[string]interface{}{patchKey: "delete"},
+	}
+
+	result := Merge(dst, src, Strategic)
+
+	_, exists := result["app"]
+	assert.False(t, exists)
+}
+
+func TestMergeStrategicPatchReplace(t *testing.T) {
+	dst := map[string]interface{}{
+		"database": map[string]interface{}{"host": "localhost", "port": 5432},
+	}
+	src := map[string]interface{}{
+		"database": map[string]interface{}{patchKey: "replace", "host": "prod-db"},
+	}
+
+	result := Merge(dst, src, Strategic)
+
+	assert.Equal(t, map[string]interface{}{"host": "prod-db"}, result["database"])
+}
+
+func TestMergeStrategicTopLevelReplace(t *testing.T) {
+	dst := map[string]interface{}{"app": "old", "database": "old"}
+	src := map[string]interface{}{patchKey: "replace", "app": "new"}
+
+	result := Merge(dst, src, Strategic)
+
+	assert.Equal(t, map[string]interface{}{"app": "new"}, result)
+}
+
+func TestMergeStrategicListMergeKeyed(t *testing.T) {
+	dst := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{"name": "alice", "role": "admin"},
+			map[string]interface{}{"name": "bob", "role": "viewer"},
+		},
+	}
+	src := map[string]interface{}{
+		"users": []interface{}{
+			map[string]interface{}{patchKey: "merge"},
+			map[string]interface{}{"name": "bob", patchKey: "delete"},
+			map[string]interface{}{"name": "carol", "role": "editor"},
+		},
+	}
+
+	result := Merge(dst, src, Strategic)
+
+	expected := []interface{}{
+		map[string]interface{}{"name": "alice", "role": "admin"},
+		map[string]interface{}{"name": "carol", "role": "editor"},
+	}
+	assert.Equal(t, expected, result["users"])
+}
+
+// TestMergeStrategicDoesNotMutateDst guards against a regression where mergeStrategic wrote
+// directly into dst: callers such as provenance tracking keep a reference to the pre-merge
+// document to diff against the result, so Merge must never change it in place.
+func TestMergeStrategicDoesNotMutateDst(t *testing.T) {
+	dst := map[string]interface{}{
+		"app": map[string]interface{}{"env": "default"},
+	}
+	before := cloneMap(dst)
+	src := map[string]interface{}{
+		"app": map[string]interface{}{"env": "prod"},
+	}
+
+	result := Merge(dst, src, Strategic)
+
+	assert.Equal(t, before, dst)
+	assert.Equal(t, map[string]interface{}{"app": map[string]interface{}{"env": "prod"}}, result)
+}
+
+func TestMergeStrategicListWithoutMergeMarkerReplaces(t *testing.T) {
+	dst := map[string]interface{}{"items": []interface{}{"a", "b"}}
+	src := map[string]interface{}{"items": []interface{}{"c"}}
+
+	result := Merge(dst, src, Strategic)
+
+	assert.Equal(t, []interface{}{"c"}, result["items"])
+}
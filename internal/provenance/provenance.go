@@ -0,0 +1,136 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package provenance tracks which layer file set each leaf key of a merged hierarchy document,
+// and which earlier files' values it overrode, powering the `hierarchy explain` subcommand.
+package provenance
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Override records a value a leaf key held before a later file overrode it.
+type Override struct {
+	Source string      `json:"source"`
+	Value  interface{} `json:"value"`
+}
+
+// Entry is the current resolution of a single leaf key: the file that set its final value, and
+// the chain of files/values it overrode, oldest first.
+type Entry struct {
+	Source   string      `json:"source"`
+	Value    interface{} `json:"value"`
+	Previous []Override  `json:"previous,omitempty"`
+}
+
+// Tracker accumulates provenance across a sequence of merges, keyed by dotted leaf path
+// (e.g. "database.port").
+type Tracker struct {
+	entries map[string]Entry
+}
+
+// NewTracker returns an empty Tracker.
+func NewTracker() *Tracker {
+	return &Tracker{entries: map[string]Entry{}}
+}
+
+// Update compares the merged document before and after applying one file from source, and
+// records the leaf keys that were added or changed as now coming from source. Leaf keys that
+// disappeared (e.g. through a strategic `$patch: delete`) are dropped from the tracker.
+func (t *Tracker) Update(before, after map[string]interface{}, source string) {
+	beforeLeaves := flatten(before)
+	afterLeaves := flatten(after)
+
+	for path, value := range afterLeaves {
+		old, existed := beforeLeaves[path]
+		if existed && reflect.DeepEqual(old, value) {
+			continue
+		}
+
+		var previous []Override
+		if prior, ok := t.entries[path]; ok {
+			previous = append(append([]Override{}, prior.Previous...), Override{Source: prior.Source, Value: prior.Value})
+		}
+
+		t.entries[path] = Entry{Source: source, Value: value, Previous: previous}
+	}
+
+	for path := range beforeLeaves {
+		if _, stillPresent := afterLeaves[path]; !stillPresent {
+			delete(t.entries, path)
+		}
+	}
+}
+
+// Entries returns the current provenance for every tracked leaf path.
+func (t *Tracker) Entries() map[string]Entry {
+	return t.entries
+}
+
+// Lookup returns the provenance for a single dotted leaf path.
+func (t *Tracker) Lookup(path string) (Entry, bool) {
+	entry, ok := t.entries[path]
+	return entry, ok
+}
+
+// Explain renders the resolution chain for a leaf path as a human-readable string, e.g.:
+//
+//	testdata/default/defaults.yml: "foo" -> testdata/json/override.json: "bar" (final)
+func (e Entry) Explain() string {
+	var b strings.Builder
+	for _, prev := range e.Previous {
+		fmt.Fprintf(&b, "%s: %#v -> ", prev.Source, prev.Value)
+	}
+	fmt.Fprintf(&b, "%s: %#v (final)", e.Source, e.Value)
+	return b.String()
+}
+
+// flatten walks doc and returns every leaf value keyed by its dotted path. Maps are descended
+// into; any other value, including lists, is treated as a leaf.
+func flatten(doc map[string]interface{}) map[string]interface{} {
+	leaves := map[string]interface{}{}
+	flattenInto(doc, "", leaves)
+	return leaves
+}
+
+func flattenInto(node map[string]interface{}, prefix string, leaves map[string]interface{}) {
+	for key, value := range node {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+
+		if child, ok := value.(map[string]interface{}); ok {
+			flattenInto(child, path, leaves)
+			continue
+		}
+
+		leaves[path] = value
+	}
+}
+
+// SortedPaths returns the dotted leaf paths tracked by t, sorted for stable output.
+func (t *Tracker) SortedPaths() []string {
+	paths := make([]string, 0, len(t.entries))
+	for path := range t.entries {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provenance
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrackerRecordsOverrideChain(t *testing.T) {
+	tracker := NewTracker()
+
+	before := map[string]interface{}{}
+	after := map[string]interface{}{"app": map[string]interface{}{"env": "default"}}
+	tracker.Update(before, after, "defaults.yml")
+
+	before, after = after, map[string]interface{}{"app": map[string]interface{}{"env": "prod"}}
+	tracker.Update(before, after, "override.json")
+
+	entry, ok := tracker.Lookup("app.env")
+	assert.True(t, ok)
+	assert.Equal(t, "override.json", entry.Source)
+	assert.Equal(t, "prod", entry.Value)
+	assert.Equal(t, []Override{{Source: "defaults.yml", Value: "default"}}, entry.Previous)
+}
+
+func TestTrackerDropsDeletedLeaves(t *testing.T) {
+	tracker := NewTracker()
+
+	before := map[string]interface{}{}
+	after := map[string]interface{}{"app": map[string]interface{}{"env": "default"}}
+	tracker.Update(before, after, "defaults.yml")
+
+	before, after = after, map[string]interface{}{}
+	tracker.Update(before, after, "overlay.yml")
+
+	_, ok := tracker.Lookup("app.env")
+	assert.False(t, ok)
+}
+
+func TestTrackerIgnoresUnchangedLeaves(t *testing.T) {
+	tracker := NewTracker()
+
+	doc := map[string]interface{}{"app": map[string]interface{}{"env": "default"}}
+	tracker.Update(map[string]interface{}{}, doc, "defaults.yml")
+	tracker.Update(doc, doc, "noop.yml")
+
+	entry, ok := tracker.Lookup("app.env")
+	assert.True(t, ok)
+	assert.Equal(t, "defaults.yml", entry.Source)
+	assert.Empty(t, entry.Previous)
+}
+
+func TestEntryExplain(t *testing.T) {
+	entry := Entry{
+		Source:   "override.json",
+		Value:    "bar",
+		Previous: []Override{{Source: "defaults.yml", Value: "foo"}},
+	}
+
+	assert.Equal(t, `defaults.yml: "foo" -> override.json: "bar" (final)`, entry.Explain())
+}
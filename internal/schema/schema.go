@@ -0,0 +1,198 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema runs a post-merge JSON Schema validation pass over hierarchy's merged output.
+// Several schema documents, typically one per hierarchy layer, are composed with `allOf` so each
+// can contribute its own constraints without the others needing to know about them.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	jsonschema "github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// Violation describes a single constraint the merged output failed to satisfy.
+type Violation struct {
+	// Path is the dotted location of the offending value within the merged document,
+	// e.g. "database.port".
+	Path string `json:"path"`
+	// Rule is the JSON Schema keyword that rejected the value, e.g. "minimum" or "type".
+	Rule string `json:"rule"`
+	// OffendingValue is the value found at Path.
+	OffendingValue interface{} `json:"offendingValue"`
+}
+
+// Validate compiles schemaFiles and validates doc against all of them as if combined with a
+// single top-level `allOf`, so that every schema must be satisfied. It returns the violations
+// found, or a nil slice if doc satisfies every schema. An error is returned only if a schema
+// file could not be read or compiled, or doc could not be converted to a JSON-compatible value.
+func Validate(schemaFiles []string, doc map[string]interface{}) ([]Violation, error) {
+	instance, err := toJSONValue(doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to prepare merged output for validation: %w", err)
+	}
+
+	sch, err := compileAllOf(schemaFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	err = sch.Validate(instance)
+	if err == nil {
+		return nil, nil
+	}
+
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, fmt.Errorf("unable to validate merged output: %w", err)
+	}
+
+	return flatten(verr, instance, nil), nil
+}
+
+// rootResourceID is the synthetic URL given to the composed `allOf` root schema. It needs no
+// particular form; it just has to be distinct from every schema file's own resource ID below.
+const rootResourceID = "hierarchy:///composed-schema.json"
+
+// compileAllOf loads schemaFiles and compiles a synthetic root schema that requires every one
+// of them to pass, via `allOf`. Each schema file is registered under a synthetic resource ID
+// rather than its file path, so that relative `$ref`s inside the composed root resolve against
+// those IDs instead of being mistaken for filesystem or HTTP references.
+func compileAllOf(schemaFiles []string) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+
+	refs := make([]interface{}, 0, len(schemaFiles))
+	for i, file := range schemaFiles {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read schema %s: %w", file, err)
+		}
+
+		id := fmt.Sprintf("hierarchy:///schema-%d.json", i)
+		if err := compiler.AddResource(id, bytes.NewReader(data)); err != nil {
+			return nil, fmt.Errorf("unable to load schema %s: %w", file, err)
+		}
+		refs = append(refs, map[string]interface{}{"$ref": id})
+	}
+
+	root, err := json.Marshal(map[string]interface{}{"allOf": refs})
+	if err != nil {
+		return nil, fmt.Errorf("unable to compose schemas: %w", err)
+	}
+	if err := compiler.AddResource(rootResourceID, bytes.NewReader(root)); err != nil {
+		return nil, fmt.Errorf("unable to compose schemas: %w", err)
+	}
+
+	sch, err := compiler.Compile(rootResourceID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile schema: %w", err)
+	}
+	return sch, nil
+}
+
+// flatten walks a ValidationError tree and collects one Violation per leaf cause, i.e. per
+// keyword that actually rejected a value rather than a wrapping `allOf`/`properties` failure.
+func flatten(verr *jsonschema.ValidationError, instance interface{}, violations []Violation) []Violation {
+	if len(verr.Causes) == 0 {
+		return append(violations, Violation{
+			Path:           pointerToPath(verr.InstanceLocation),
+			Rule:           lastSegment(verr.KeywordLocation),
+			OffendingValue: resolvePointer(instance, verr.InstanceLocation),
+		})
+	}
+
+	for _, cause := range verr.Causes {
+		violations = flatten(cause, instance, violations)
+	}
+	return violations
+}
+
+// pointerToPath converts a JSON pointer such as "/database/port" into the dotted path used
+// elsewhere in hierarchy, such as "database.port". The root pointer ("") becomes ".".
+func pointerToPath(pointer string) string {
+	segments := splitPointer(pointer)
+	if len(segments) == 0 {
+		return "."
+	}
+	return strings.Join(segments, ".")
+}
+
+// lastSegment returns the final path segment of a JSON pointer, which for a KeywordLocation is
+// the keyword that performed the failing check, e.g. "minimum" or "type".
+func lastSegment(pointer string) string {
+	segments := splitPointer(pointer)
+	if len(segments) == 0 {
+		return pointer
+	}
+	return segments[len(segments)-1]
+}
+
+// splitPointer splits a JSON pointer into its unescaped segments.
+func splitPointer(pointer string) []string {
+	var segments []string
+	for _, segment := range strings.Split(strings.TrimPrefix(pointer, "/"), "/") {
+		if segment == "" {
+			continue
+		}
+		segment = strings.ReplaceAll(segment, "~1", "/")
+		segment = strings.ReplaceAll(segment, "~0", "~")
+		segments = append(segments, segment)
+	}
+	return segments
+}
+
+// resolvePointer returns the value addressed by pointer within instance, or nil if it cannot
+// be resolved.
+func resolvePointer(instance interface{}, pointer string) interface{} {
+	current := instance
+	for _, segment := range splitPointer(pointer) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			current = node[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			current = node[index]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+// toJSONValue round-trips doc through encoding/json so that it carries the canonical JSON types
+// (float64 for numbers, etc.) the schema library expects, rather than the mix of int/float64
+// produced by the YAML decoder.
+func toJSONValue(doc map[string]interface{}) (interface{}, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var instance interface{}
+	if err := json.Unmarshal(data, &instance); err != nil {
+		return nil, err
+	}
+	return instance, nil
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testDoc() map[string]interface{} {
+	return map[string]interface{}{
+		"app": map[string]interface{}{
+			"env":  "test1",
+			"name": "hierarchy",
+		},
+		"database": map[string]interface{}{
+			"host": "localhost",
+			"port": 5433,
+		},
+	}
+}
+
+func TestValidateSuccess(t *testing.T) {
+	violations, err := Validate([]string{"../../testdata/test1/schema/base.schema.json"}, testDoc())
+	assert.NoError(t, err)
+	assert.Empty(t, violations)
+}
+
+func TestValidateComposesSchemasAndReportsViolation(t *testing.T) {
+	schemaFiles := []string{
+		"../../testdata/test1/schema/base.schema.json",
+		"../../testdata/test1/schema/fail.schema.json",
+	}
+
+	violations, err := Validate(schemaFiles, testDoc())
+	assert.NoError(t, err)
+
+	expected := []Violation{{Path: "database.port", Rule: "minimum", OffendingValue: float64(5433)}}
+	assert.Equal(t, expected, violations)
+}
+
+func TestValidateUnknownSchemaFile(t *testing.T) {
+	_, err := Validate([]string{"../../testdata/test1/schema/does-not-exist.json"}, testDoc())
+	assert.Error(t, err)
+}
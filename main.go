@@ -0,0 +1,612 @@
+/*
+Copyright 2021 Kohl's Department Stores, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Smiley73/hierarchy/internal/fetch"
+	"github.com/Smiley73/hierarchy/internal/merge"
+	"github.com/Smiley73/hierarchy/internal/provenance"
+	"github.com/Smiley73/hierarchy/internal/schema"
+	"github.com/Smiley73/hierarchy/pkg/version"
+)
+
+// originSuffix is appended to a run's output file to name its provenance sidecar file.
+const originSuffix = ".origin"
+
+// defaultFileFilter matches the config file extensions merged by default: yml, yaml and json.
+const defaultFileFilter = `\.(yml|yaml|json)$`
+
+// defaultLocalSuffix names the layer-local override file merged immediately after its base file,
+// e.g. "defaults.yml" + "defaults.yml.local".
+const defaultLocalSuffix = ".local"
+
+// envVarPattern matches `${VAR}` references inside a hierarchy.lst entry.
+var envVarPattern = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// strategyPattern matches the optional `[strategy=...]` directive trailing a hierarchy.lst entry.
+var strategyPattern = regexp.MustCompile(`^(.*?)\s*\[strategy=(\w+)\]$`)
+
+// schemaLinePattern matches a `schema: <path>` directive inside hierarchy.lst, which contributes
+// an additional JSON Schema document to validate the merged output against.
+var schemaLinePattern = regexp.MustCompile(`^schema:\s*(.+)$`)
+
+// exportLinePattern matches an `export NAME=value` directive inside hierarchy.lst, which sets
+// NAME in the process environment so later entries' `${NAME}` references can resolve it.
+var exportLinePattern = regexp.MustCompile(`^export\s+(\w+)\s*=\s*(.*)$`)
+
+// exportFromPattern matches an `export NAME from file.yml:some.path` directive, which sets NAME
+// to the value found at the dotted path some.path within file.yml.
+var exportFromPattern = regexp.MustCompile(`^export\s+(\w+)\s+from\s+(\S+):(\S+)$`)
+
+// hierarchyEntry is one resolved, ordered line of a hierarchy.lst file: the directory to merge
+// and the merge.Strategy selected for it.
+type hierarchyEntry struct {
+	dir      string
+	strategy merge.Strategy
+}
+
+// config holds the resolved command line options for a single run of hierarchy.
+type config struct {
+	hierarchyFile   string
+	basePath        string
+	outputFile      string
+	filterExtension string
+	logDebug        bool
+	logTrace        bool
+	failMissing     bool
+	showVersion     bool
+	cacheDir        string
+	offline         bool
+	schemaFiles     stringList
+	schemaOnly      bool
+	localSuffix     string
+	envFile         string
+	strictEnv       bool
+}
+
+// stringList accumulates repeated occurrences of a flag into a slice, e.g.
+// `--schema a.json --schema b.json`.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		runExplain(os.Args[2:])
+		return
+	}
+
+	cfg := parseFlags()
+
+	if cfg.showVersion {
+		version.Print()
+		return
+	}
+
+	if cfg.logTrace {
+		log.SetLevel(log.TraceLevel)
+	} else if cfg.logDebug {
+		log.SetLevel(log.DebugLevel)
+	}
+
+	version.Log()
+
+	if cfg.envFile != "" {
+		if err := loadEnvFile(cfg.envFile); err != nil {
+			log.WithError(err).WithField("file", cfg.envFile).Fatal("unable to load env file")
+		}
+	}
+
+	hierarchy, schemaFiles := processHierarchy(cfg)
+	schemaFiles = append(schemaFiles, cfg.schemaFiles...)
+
+	merged, tracker := buildMerged(hierarchy, cfg.filterExtension, cfg.localSuffix)
+	validateSchema(schemaFiles, merged)
+
+	if !cfg.schemaOnly {
+		writeMerged(merged, tracker, cfg.outputFile)
+	}
+}
+
+// parseFlags reads the command line flags into a config.
+func parseFlags() config {
+	var cfg config
+
+	flag.StringVar(&cfg.hierarchyFile, "hierarchy", "hierarchy.lst", "path to the file listing the directories to merge")
+	flag.StringVar(&cfg.basePath, "base", ".", "base path that relative hierarchy entries are resolved against")
+	flag.StringVar(&cfg.outputFile, "output", "output.yaml", "path of the merged output file")
+	flag.StringVar(&cfg.filterExtension, "filter", defaultFileFilter, "regular expression used to select config files within a directory")
+	flag.BoolVar(&cfg.logDebug, "debug", false, "enable debug logging")
+	flag.BoolVar(&cfg.logTrace, "trace", false, "enable trace logging")
+	flag.BoolVar(&cfg.failMissing, "failmissing", false, "fail if a hierarchy entry does not contain any matching config files")
+	flag.BoolVar(&cfg.showVersion, "version", false, "print the version and exit")
+	flag.StringVar(&cfg.cacheDir, "cache-dir", ".hierarchy-cache", "directory used to cache remote hierarchy entries (http, git, ...)")
+	flag.BoolVar(&cfg.offline, "offline", false, "never fetch remote hierarchy entries over the network, only use what is already cached")
+	flag.Var(&cfg.schemaFiles, "schema", "path to a JSON Schema document to validate the merged output against; may be repeated")
+	flag.BoolVar(&cfg.schemaOnly, "schema-only", false, "validate the merged output against the configured schema(s) without writing it")
+	flag.StringVar(&cfg.localSuffix, "local-suffix", defaultLocalSuffix, "suffix identifying a layer-local override file merged immediately after its base file; a \"<base>.d\" directory of matching files is always applied as drop-ins after it")
+	flag.StringVar(&cfg.envFile, "env-file", "", "path to a NAME=value file preloaded into the environment before the hierarchy is processed")
+	flag.BoolVar(&cfg.strictEnv, "strict-env", false, "collect every unresolved ${VAR} reference across the whole hierarchy before failing, instead of failing on the first one")
+	flag.Parse()
+
+	return cfg
+}
+
+// getFiles returns the sorted, absolute list of files in dir whose name matches filterExtension.
+// Files ending in `.disabled` are always excluded, regardless of the filter.
+func getFiles(dir string, filterExtension string) []string {
+	matcher := regexp.MustCompile(filterExtension)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.WithError(err).WithField("dir", dir).Debug("unable to read directory")
+		return nil
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(entry.Name(), ".disabled") {
+			continue
+		}
+		if !matcher.MatchString(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(dir, entry.Name()))
+	}
+
+	sort.Strings(files)
+
+	return files
+}
+
+// processHierarchy reads cfg.hierarchyFile and returns the ordered list of directories to merge,
+// along with any additional JSON Schema files contributed via `schema:` directives.
+// Blank lines and lines starting with `#` are ignored. Entries may reference `${VAR}` environment
+// variables, which are expanded before the path is resolved against cfg.basePath, and may end in
+// a `[strategy=...]` directive selecting the merge.Strategy used for that layer (default deepMerge).
+// An entry that carries a URI scheme (http, https, git, git+https, s3, file, ...) is downloaded
+// through the fetch package into cfg.cacheDir instead of being resolved as a local path. If
+// cfg.failMissing is set, an entry that does not contain any file matching cfg.filterExtension
+// is treated as a fatal error. A line of the form `schema: <path>` is resolved the same way as a
+// hierarchy entry, but contributes to the returned schema file list instead of the hierarchy.
+//
+// A line of the form `export NAME=value` or `export NAME from file.yml:some.path` sets NAME in
+// the process environment as soon as it is encountered, so `${NAME}` references in later lines
+// pick it up. Unresolved `${VAR}` references are normally fatal the moment they are found; if
+// cfg.strictEnv is set, resolution instead continues to the end of the file so every unresolved
+// variable across the whole hierarchy can be reported together.
+func processHierarchy(cfg config) ([]hierarchyEntry, []string) {
+	f, err := os.Open(cfg.hierarchyFile)
+	if err != nil {
+		log.WithError(err).Fatal("unable to open hierarchy file")
+	}
+	defer f.Close()
+
+	var hierarchy []hierarchyEntry
+	var schemaFiles []string
+	var unresolvedVars []string
+
+	// resolve expands raw, either returning the expanded string and true, or recording its
+	// unresolved variables and returning false. Under cfg.strictEnv, an unresolved variable
+	// defers the fatal error to the end of the scan instead of aborting immediately.
+	resolve := func(raw string) (string, bool) {
+		expanded, missing := expandEnv(raw)
+		if len(missing) == 0 {
+			return expanded, true
+		}
+		if cfg.strictEnv {
+			unresolvedVars = append(unresolvedVars, missing...)
+			return "", false
+		}
+		log.WithField("vars", strings.Join(missing, ", ")).Fatal("unresolved environment variable(s)")
+		return "", false
+	}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if match := exportFromPattern.FindStringSubmatch(line); match != nil {
+			name, fileRef, docPath := match[1], match[2], match[3]
+
+			fileRef, ok := resolve(fileRef)
+			if !ok {
+				continue
+			}
+
+			file, err := resolveEntry(cfg, fileRef)
+			if err != nil {
+				log.WithError(err).WithField("entry", fileRef).Fatal("unable to resolve export source")
+			}
+
+			doc, err := readLayer(file)
+			if err != nil {
+				log.WithError(err).WithField("file", file).Fatal("unable to parse export source")
+			}
+
+			value, ok := lookupDotted(doc, docPath)
+			if !ok {
+				log.WithField("path", docPath).WithField("file", file).Fatal("export path not found in source file")
+			}
+
+			os.Setenv(name, fmt.Sprint(value))
+			continue
+		}
+
+		if match := exportLinePattern.FindStringSubmatch(line); match != nil {
+			name, rawValue := match[1], match[2]
+
+			value, ok := resolve(rawValue)
+			if !ok {
+				continue
+			}
+
+			os.Setenv(name, value)
+			continue
+		}
+
+		if match := schemaLinePattern.FindStringSubmatch(line); match != nil {
+			path, ok := resolve(match[1])
+			if !ok {
+				continue
+			}
+
+			file, err := resolveEntry(cfg, path)
+			if err != nil {
+				log.WithError(err).WithField("entry", path).Fatal("unable to resolve schema entry")
+			}
+
+			schemaFiles = append(schemaFiles, file)
+			continue
+		}
+
+		path, strategyName := splitStrategy(line)
+
+		strategy, err := merge.ParseStrategy(strategyName)
+		if err != nil {
+			log.WithError(err).Fatal("unable to resolve hierarchy entry")
+		}
+
+		path, ok := resolve(path)
+		if !ok {
+			continue
+		}
+
+		dir, err := resolveEntry(cfg, path)
+		if err != nil {
+			log.WithError(err).WithField("entry", path).Fatal("unable to resolve hierarchy entry")
+		}
+
+		if cfg.failMissing && len(getFiles(dir, cfg.filterExtension)) == 0 {
+			log.WithField("dir", dir).Fatal("hierarchy entry does not contain any matching config files")
+		}
+
+		hierarchy = append(hierarchy, hierarchyEntry{dir: dir, strategy: strategy})
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.WithError(err).Fatal("unable to read hierarchy file")
+	}
+
+	if len(unresolvedVars) > 0 {
+		log.WithField("vars", strings.Join(dedupSorted(unresolvedVars), ", ")).Fatal("unresolved environment variable(s)")
+	}
+
+	return hierarchy, schemaFiles
+}
+
+// lookupDotted resolves a dotted path such as "database.port" within doc, returning the value
+// found and whether every segment of path existed.
+func lookupDotted(doc map[string]interface{}, path string) (interface{}, bool) {
+	var current interface{} = doc
+	for _, segment := range strings.Split(path, ".") {
+		node, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		current, ok = node[segment]
+		if !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// dedupSorted returns the distinct values of names, sorted.
+func dedupSorted(names []string) []string {
+	seen := map[string]bool{}
+	var unique []string
+	for _, name := range names {
+		if !seen[name] {
+			seen[name] = true
+			unique = append(unique, name)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// splitStrategy strips a trailing `[strategy=...]` directive off a hierarchy.lst entry, returning
+// the bare path and the strategy name, which is empty when the entry carries no directive.
+func splitStrategy(line string) (path string, strategyName string) {
+	if match := strategyPattern.FindStringSubmatch(line); match != nil {
+		return match[1], match[2]
+	}
+	return line, ""
+}
+
+// resolveEntry turns a hierarchy.lst entry into a local directory. An entry carrying a URI
+// scheme (http, https, git, git+https, s3, file, ...) is downloaded through the fetch package
+// into cfg.cacheDir; anything else is treated as a path, resolved against cfg.basePath.
+func resolveEntry(cfg config, entry string) (string, error) {
+	if _, ok := fetch.Scheme(entry); ok {
+		return fetch.Fetch(context.Background(), entry, cfg.cacheDir, cfg.offline)
+	}
+
+	dir := entry
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cfg.basePath, dir)
+	}
+	return filepath.Clean(dir), nil
+}
+
+// expandEnv substitutes every `${VAR}` reference in line with the value of the matching
+// environment variable. Any reference that cannot be resolved is left untouched in the returned
+// string, and its variable name is returned in missing.
+func expandEnv(line string) (expanded string, missing []string) {
+	expanded = envVarPattern.ReplaceAllStringFunc(line, func(match string) string {
+		name := envVarPattern.FindStringSubmatch(match)[1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return value
+	})
+
+	return expanded, missing
+}
+
+// loadEnvFile sets a process environment variable for each `NAME=value` line in path. Blank
+// lines and lines starting with `#` are ignored.
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid line %q: expected NAME=value", line)
+		}
+
+		os.Setenv(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+
+	return scanner.Err()
+}
+
+// mergeFilesInHierarchy merges every file matching filterExtension across the given hierarchy,
+// in order, and writes the resulting document to outputFile. Later layers override earlier ones,
+// according to each entry's merge.Strategy.
+func mergeFilesInHierarchy(hierarchy []hierarchyEntry, filterExtension string, outputFile string, localSuffix string) {
+	merged, tracker := buildMerged(hierarchy, filterExtension, localSuffix)
+	writeMerged(merged, tracker, outputFile)
+}
+
+// buildMerged merges every file matching filterExtension across the given hierarchy, in order,
+// and returns the resulting document along with the provenance tracker built up alongside it.
+// Later layers override earlier ones, according to each entry's merge.Strategy. Within a layer,
+// each base file is immediately followed by its localOverrides, using that layer's strategy,
+// before the next base file in the directory is merged.
+func buildMerged(hierarchy []hierarchyEntry, filterExtension string, localSuffix string) (map[string]interface{}, *provenance.Tracker) {
+	merged := map[string]interface{}{}
+	tracker := provenance.NewTracker()
+
+	for _, entry := range hierarchy {
+		for _, file := range getFiles(entry.dir, filterExtension) {
+			merged = mergeLayerFile(merged, tracker, file, entry.strategy)
+
+			for _, override := range localOverrides(file, filterExtension, localSuffix) {
+				merged = mergeLayerFile(merged, tracker, override, entry.strategy)
+			}
+		}
+	}
+
+	return merged, tracker
+}
+
+// mergeLayerFile parses file and merges it into merged according to strategy, recording its
+// contribution in tracker.
+func mergeLayerFile(merged map[string]interface{}, tracker *provenance.Tracker, file string, strategy merge.Strategy) map[string]interface{} {
+	layer, err := readLayer(file)
+	if err != nil {
+		log.WithError(err).WithField("file", file).Fatal("unable to parse config file")
+	}
+
+	before := merged
+	merged = merge.Merge(merged, layer, strategy)
+	tracker.Update(before, merged, file)
+	return merged
+}
+
+// localOverrides returns, in application order, the layer-local override files that apply on
+// top of base within the same layer: a single "<base><localSuffix>" companion file, if present,
+// followed by every file matching filterExtension inside a "<base>.d" drop-in directory, sorted
+// by name. Files ending in `.disabled` are excluded from the drop-in directory just like any
+// other hierarchy directory.
+func localOverrides(base string, filterExtension string, localSuffix string) []string {
+	var overrides []string
+
+	if companion := base + localSuffix; isFile(companion) {
+		overrides = append(overrides, companion)
+	}
+
+	overrides = append(overrides, getFiles(base+".d", filterExtension)...)
+
+	return overrides
+}
+
+// isFile reports whether path exists and is a regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// writeMerged marshals merged to YAML and writes it to outputFile, alongside a provenance
+// sidecar built from tracker.
+func writeMerged(merged map[string]interface{}, tracker *provenance.Tracker, outputFile string) {
+	out, err := yaml.Marshal(merged)
+	if err != nil {
+		log.WithError(err).Fatal("unable to marshal merged output")
+	}
+
+	if err := ioutil.WriteFile(outputFile, out, 0644); err != nil {
+		log.WithError(err).WithField("file", outputFile).Fatal("unable to write merged output")
+	}
+
+	if err := writeOrigin(outputFile+originSuffix, tracker); err != nil {
+		log.WithError(err).WithField("file", outputFile+originSuffix).Fatal("unable to write provenance sidecar")
+	}
+}
+
+// validateSchema runs the JSON Schema validation pass over merged when schemaFiles is non-empty,
+// logging every violation found and exiting the process if any are found.
+func validateSchema(schemaFiles []string, merged map[string]interface{}) {
+	if len(schemaFiles) == 0 {
+		return
+	}
+
+	violations, err := schema.Validate(schemaFiles, merged)
+	if err != nil {
+		log.WithError(err).Fatal("unable to validate merged output against schema")
+	}
+
+	for _, v := range violations {
+		log.WithField("path", v.Path).WithField("rule", v.Rule).WithField("offendingValue", v.OffendingValue).
+			Error("merged output violates schema")
+	}
+
+	if len(violations) > 0 {
+		log.Fatal("merged output failed schema validation")
+	}
+}
+
+// writeOrigin serializes tracker's provenance to path as JSON, mapping each dotted leaf path to
+// the Entry describing which file produced its final value.
+func writeOrigin(path string, tracker *provenance.Tracker) error {
+	out, err := json.MarshalIndent(tracker.Entries(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, out, 0644)
+}
+
+// runExplain implements the `hierarchy explain` subcommand: `explain <key.path>` prints the
+// resolution chain for a single leaf, and `explain --all` prints every tracked leaf. Both read
+// the provenance sidecar written by a prior merge run alongside --output.
+func runExplain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	outputFile := fs.String("output", "output.yaml", "path of the merged output file whose sidecar should be explained")
+	all := fs.Bool("all", false, "print the resolution chain for every tracked leaf key")
+	fs.Parse(args)
+
+	data, err := ioutil.ReadFile(*outputFile + originSuffix)
+	if err != nil {
+		log.WithError(err).Fatal("unable to read provenance sidecar; run a merge first")
+	}
+
+	entries := map[string]provenance.Entry{}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		log.WithError(err).Fatal("unable to parse provenance sidecar")
+	}
+
+	if *all {
+		paths := make([]string, 0, len(entries))
+		for path := range entries {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			fmt.Printf("%s: %s\n", path, entries[path].Explain())
+		}
+		return
+	}
+
+	if fs.NArg() != 1 {
+		log.Fatal("usage: hierarchy explain <key.path> | hierarchy explain --all")
+	}
+
+	entry, ok := entries[fs.Arg(0)]
+	if !ok {
+		log.WithField("path", fs.Arg(0)).Fatal("no such key in the merged output")
+	}
+
+	fmt.Println(entry.Explain())
+}
+
+// readLayer loads a single YAML or JSON file into a generic map. JSON is valid YAML, so both
+// extensions are handled by the same decoder.
+func readLayer(file string) (map[string]interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	layer := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &layer); err != nil {
+		return nil, err
+	}
+
+	return layer, nil
+}
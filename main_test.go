@@ -20,9 +20,14 @@ import (
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Smiley73/hierarchy/internal/merge"
+	"github.com/Smiley73/hierarchy/internal/provenance"
 )
 
 // TestGetFilesSuccess verifies that we receive the correct list of files to be merged
@@ -51,9 +56,16 @@ func TestProcessHierarchySuccess(t *testing.T) {
 	cfg.logTrace = false
 	cfg.failMissing = false
 
-	expected := []string{"testdata/default", "testdata/yaml", "testdata/json", "testdata/empty", "testdata/test1"}
-	result := processHierarchy(cfg)
+	expected := []hierarchyEntry{
+		{dir: "testdata/default", strategy: merge.DeepMerge},
+		{dir: "testdata/yaml", strategy: merge.DeepMerge},
+		{dir: "testdata/json", strategy: merge.DeepMerge},
+		{dir: "testdata/empty", strategy: merge.DeepMerge},
+		{dir: "testdata/test1", strategy: merge.DeepMerge},
+	}
+	result, schemaFiles := processHierarchy(cfg)
 	assert.Equal(t, expected, result)
+	assert.Empty(t, schemaFiles)
 }
 
 // TestFailMissing tests the correct behavior of the `--failmissing` command line option
@@ -98,12 +110,13 @@ func TestEnd2EndSuccess(t *testing.T) {
 	cfg.logDebug = false
 	cfg.logTrace = false
 	cfg.failMissing = false
+	cfg.localSuffix = defaultLocalSuffix
 
 	// process the hierarchy and get the list of include files
-	hierarchy := processHierarchy(cfg)
+	hierarchy, _ := processHierarchy(cfg)
 
 	// Lets do the deed
-	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile)
+	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile, cfg.localSuffix)
 
 	expected, err := ioutil.ReadFile("testdata/test1/result/expected.yaml")
 	if err != nil {
@@ -160,15 +173,16 @@ func TestEnd2EndEnvironmentVariablesSuccess(t *testing.T) {
 	cfg.logDebug = false
 	cfg.logTrace = false
 	cfg.failMissing = false
+	cfg.localSuffix = defaultLocalSuffix
 
 	// set the test environment variable
 	os.Setenv("JSON", "json")
 
 	// process the hierarchy and get the list of include files
-	hierarchy := processHierarchy(cfg)
+	hierarchy, _ := processHierarchy(cfg)
 
 	// Merge files
-	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile)
+	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile, cfg.localSuffix)
 
 	expected, err := ioutil.ReadFile("testdata/test2-with-env/result/expected.yaml")
 	if err != nil {
@@ -179,4 +193,288 @@ func TestEnd2EndEnvironmentVariablesSuccess(t *testing.T) {
 		t.Fatalf("Error reading output file: %v", err)
 	}
 	assert.Equal(t, string(expected), string(result))
+}
+
+// TestLocalOverridesSuccess verifies that localOverrides finds a base file's `.local` companion
+// and the contents of its `.d` drop-in directory, in application order.
+func TestLocalOverridesSuccess(t *testing.T) {
+	expected := []string{
+		"testdata/localoverride/layer1/base.yml.local",
+		"testdata/localoverride/layer1/base.yml.d/10-extra.yml",
+	}
+	result := localOverrides("testdata/localoverride/layer1/base.yml", defaultFileFilter, defaultLocalSuffix)
+	assert.Equal(t, expected, result)
+
+	// a base file with no companion or drop-in directory has no overrides
+	assert.Empty(t, localOverrides("testdata/localoverride/layer2/base.yml", defaultFileFilter, defaultLocalSuffix))
+}
+
+// TestEnd2EndLocalOverrideSuccess verifies the precedence of a layer-local override and its
+// drop-in directory against their base file and against a later hierarchy layer: base <
+// base.local < base.d/* < next layer.
+func TestEnd2EndLocalOverrideSuccess(t *testing.T) {
+	var cfg config
+
+	cfg.hierarchyFile = "testdata/localoverride/hierarchy.lst"
+	cfg.basePath = "testdata/localoverride"
+	cfg.outputFile = "output.yaml"
+	cfg.filterExtension = defaultFileFilter
+	cfg.localSuffix = defaultLocalSuffix
+
+	hierarchy, _ := processHierarchy(cfg)
+	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile, cfg.localSuffix)
+
+	expected, err := ioutil.ReadFile("testdata/localoverride/result/expected.yaml")
+	if err != nil {
+		t.Fatalf("Error reading file with expected test results: %v", err)
+	}
+	result, err := ioutil.ReadFile(cfg.outputFile)
+	if err != nil {
+		t.Fatalf("Error reading output file: %v", err)
+	}
+	assert.Equal(t, string(expected), string(result))
+}
+
+// TestLocalOverrideHonorsStrategicPatch verifies that a `.local` override applies through the
+// same merge.Strategy as its base file, so a strategic `$patch: delete` in the override still
+// removes a key introduced by the base file.
+func TestLocalOverrideHonorsStrategicPatch(t *testing.T) {
+	dir := t.TempDir()
+
+	base := map[string]interface{}{"feature": map[string]interface{}{"flagA": true, "flagB": true}}
+	writeYAML(t, filepath.Join(dir, "base.yml"), base)
+
+	local := map[string]interface{}{"feature": map[string]interface{}{"flagB": map[string]interface{}{"$patch": "delete"}}}
+	writeYAML(t, filepath.Join(dir, "base.yml.local"), local)
+
+	hierarchy := []hierarchyEntry{{dir: dir, strategy: merge.Strategic}}
+	merged, _ := buildMerged(hierarchy, defaultFileFilter, defaultLocalSuffix)
+
+	expected := map[string]interface{}{"feature": map[string]interface{}{"flagA": true}}
+	assert.Equal(t, expected, merged)
+}
+
+// TestBuildMergedTracksStrategicProvenance verifies that a Strategic layer overriding a key set
+// by an earlier layer is correctly reflected in the provenance tracker, and that the chain
+// survives a round trip through writeOrigin and the `explain` subcommand. This guards against a
+// regression where mergeStrategic mutated its dst argument in place, so mergeLayerFile's
+// before/after snapshots aliased the same map and every Strategic layer's contribution was
+// invisible to the tracker.
+func TestBuildMergedTracksStrategicProvenance(t *testing.T) {
+	dir := t.TempDir()
+
+	baseDir := filepath.Join(dir, "base")
+	overrideDir := filepath.Join(dir, "override")
+	if err := os.MkdirAll(baseDir, 0755); err != nil {
+		t.Fatalf("unable to create base dir: %v", err)
+	}
+	if err := os.MkdirAll(overrideDir, 0755); err != nil {
+		t.Fatalf("unable to create override dir: %v", err)
+	}
+
+	baseFile := filepath.Join(baseDir, "app.yml")
+	writeYAML(t, baseFile, map[string]interface{}{"app": map[string]interface{}{"env": "default"}})
+
+	overrideFile := filepath.Join(overrideDir, "app.yml")
+	writeYAML(t, overrideFile, map[string]interface{}{"app": map[string]interface{}{"env": "prod"}})
+
+	hierarchy := []hierarchyEntry{
+		{dir: baseDir, strategy: merge.DeepMerge},
+		{dir: overrideDir, strategy: merge.Strategic},
+	}
+	merged, tracker := buildMerged(hierarchy, defaultFileFilter, defaultLocalSuffix)
+
+	expected := map[string]interface{}{"app": map[string]interface{}{"env": "prod"}}
+	assert.Equal(t, expected, merged)
+
+	entry, ok := tracker.Lookup("app.env")
+	if !assert.True(t, ok, "expected app.env to be tracked") {
+		return
+	}
+	assert.Equal(t, overrideFile, entry.Source)
+	assert.Equal(t, "prod", entry.Value)
+	assert.Equal(t, []provenance.Override{{Source: baseFile, Value: "default"}}, entry.Previous)
+
+	outputFile := filepath.Join(dir, "output.yaml")
+	if err := writeOrigin(outputFile+originSuffix, tracker); err != nil {
+		t.Fatalf("unable to write provenance sidecar: %v", err)
+	}
+
+	stdout := captureStdout(t, func() {
+		runExplain([]string{"--output", outputFile, "app.env"})
+	})
+	assert.Equal(t, entry.Explain()+"\n", stdout)
+}
+
+// captureStdout redirects os.Stdout for the duration of fn and returns everything written to it.
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to create pipe: %v", err)
+	}
+
+	original := os.Stdout
+	os.Stdout = w
+	fn()
+	os.Stdout = original
+	w.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("unable to read captured stdout: %v", err)
+	}
+	return string(out)
+}
+
+// writeYAML marshals doc as YAML and writes it to path, failing the test on error.
+func writeYAML(t *testing.T, path string, doc interface{}) {
+	t.Helper()
+
+	out, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("unable to marshal fixture: %v", err)
+	}
+	if err := ioutil.WriteFile(path, out, 0644); err != nil {
+		t.Fatalf("unable to write fixture: %v", err)
+	}
+}
+
+// TestEnd2EndExportSuccess verifies that both forms of the `export` directive - a literal value
+// and one read from a file - make their variable available to `${VAR}` references in later
+// hierarchy.lst entries.
+func TestEnd2EndExportSuccess(t *testing.T) {
+	t.Cleanup(func() {
+		os.Unsetenv("NAME")
+		os.Unsetenv("GREETING")
+	})
+
+	var cfg config
+
+	cfg.hierarchyFile = "testdata/test3-with-export/hierarchy.lst"
+	cfg.basePath = "testdata/test3-with-export"
+	cfg.outputFile = "output.yaml"
+	cfg.filterExtension = defaultFileFilter
+	cfg.localSuffix = defaultLocalSuffix
+
+	hierarchy, _ := processHierarchy(cfg)
+	mergeFilesInHierarchy(hierarchy, cfg.filterExtension, cfg.outputFile, cfg.localSuffix)
+
+	expected, err := ioutil.ReadFile("testdata/test3-with-export/result/expected.yaml")
+	if err != nil {
+		t.Fatalf("Error reading file with expected test results: %v", err)
+	}
+	result, err := ioutil.ReadFile(cfg.outputFile)
+	if err != nil {
+		t.Fatalf("Error reading output file: %v", err)
+	}
+	assert.Equal(t, string(expected), string(result))
+}
+
+// TestSchemaOnlyFailsWithoutWritingOutput verifies that a `schema:` line in hierarchy.lst is
+// wired into validation, and that with --schema-only set, a merged document failing that schema
+// makes the process exit non-zero without ever writing the output file.
+// It spawns a new process to determine the exit code of the application.
+// Anything other than a 1 is a problem
+// It uses the environment variable TEST_FAIL_EMPTY to signal the actual execution of the functionality
+func TestSchemaOnlyFailsWithoutWritingOutput(t *testing.T) {
+	outputFile := filepath.Join(t.TempDir(), "output.yaml")
+
+	if os.Getenv("TEST_FAIL_EMPTY") == "1" {
+		var cfg config
+		cfg.hierarchyFile = "testdata/test4-with-schema-fail/hierarchy.lst"
+		cfg.basePath = "testdata/test4-with-schema-fail"
+		cfg.outputFile = os.Getenv("TEST_OUTPUT_FILE")
+		cfg.filterExtension = defaultFileFilter
+		cfg.localSuffix = defaultLocalSuffix
+		cfg.schemaOnly = true
+
+		hierarchy, schemaFiles := processHierarchy(cfg)
+		merged, tracker := buildMerged(hierarchy, cfg.filterExtension, cfg.localSuffix)
+		validateSchema(schemaFiles, merged)
+
+		if !cfg.schemaOnly {
+			writeMerged(merged, tracker, cfg.outputFile)
+		}
+
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestSchemaOnlyFailsWithoutWritingOutput")
+	cmd.Env = append(os.Environ(), "TEST_FAIL_EMPTY=1", "TEST_OUTPUT_FILE="+outputFile)
+	err := cmd.Run()
+	if e, ok := err.(*exec.ExitError); !ok || e.Success() {
+		t.Fatalf("process ran with err %v, want exit status 1", err)
+	}
+
+	if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to not be written, stat returned err %v", outputFile, err)
+	}
+}
+
+// TestStrictEnvReportsEveryUnresolvedVariable ensures that, with --strict-env, a hierarchy.lst
+// referencing several unresolved variables across different lines fails only after the whole
+// file has been scanned, reporting every one of them rather than just the first.
+// It spawns a new process to determine the exit code and captured log output.
+func TestStrictEnvReportsEveryUnresolvedVariable(t *testing.T) {
+	if os.Getenv("TEST_FAIL_EMPTY") == "1" {
+		var cfg config
+		cfg.hierarchyFile = "testdata/test3-with-export-fail/hierarchy.lst"
+		cfg.basePath = "testdata/test3-with-export-fail"
+		cfg.outputFile = "output.yaml"
+		cfg.filterExtension = defaultFileFilter
+		cfg.strictEnv = true
+
+		processHierarchy(cfg)
+
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=TestStrictEnvReportsEveryUnresolvedVariable")
+	cmd.Env = append(os.Environ(), "TEST_FAIL_EMPTY=1")
+	out, err := cmd.CombinedOutput()
+
+	e, ok := err.(*exec.ExitError)
+	if !ok || e.Success() {
+		t.Fatalf("process ran with err %v, want exit status 1", err)
+	}
+
+	assert.Contains(t, string(out), "MISSING_A")
+	assert.Contains(t, string(out), "MISSING_B")
+}
+
+// TestLoadEnvFileSuccess verifies that loadEnvFile sets a process environment variable for each
+// NAME=value line, ignoring blank lines and comments.
+func TestLoadEnvFileSuccess(t *testing.T) {
+	t.Cleanup(func() {
+		os.Unsetenv("ENVFILE_VAR")
+	})
+
+	path := filepath.Join(t.TempDir(), ".env")
+	content := "# a comment\n\nENVFILE_VAR=from-file\n"
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("unable to write env file fixture: %v", err)
+	}
+
+	err := loadEnvFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "from-file", os.Getenv("ENVFILE_VAR"))
+}
+
+// TestLookupDotted verifies dotted-path navigation through a generic merged document.
+func TestLookupDotted(t *testing.T) {
+	doc := map[string]interface{}{
+		"database": map[string]interface{}{"port": 5432},
+	}
+
+	value, ok := lookupDotted(doc, "database.port")
+	assert.True(t, ok)
+	assert.Equal(t, 5432, value)
+
+	_, ok = lookupDotted(doc, "database.missing")
+	assert.False(t, ok)
+
+	_, ok = lookupDotted(doc, "database.port.nested")
+	assert.False(t, ok)
 }
\ No newline at end of file